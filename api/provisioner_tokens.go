@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+)
+
+// UsedToken describes a previously-seen token jti, surfaced to operators
+// inspecting recent activity for a subject during incident response.
+type UsedToken struct {
+	ID      string `json:"id"`
+	Subject string `json:"subject"`
+	UsedAt  int64  `json:"usedAt"`
+}
+
+// ProvisionerTokensResponse is the response body of GET /provisioners/tokens.
+type ProvisionerTokensResponse struct {
+	Tokens []UsedToken `json:"tokens"`
+}
+
+// ProvisionerTokens is an HTTP handler that lists recently used OTT jtis for
+// the subject given in the "subject" query parameter, or every recorded token
+// if subject is omitted, matching GetUsedTokens/TokenStore.List's own
+// empty-subject-means-everything semantics. An incident responder who
+// doesn't yet know which subject is affected needs exactly this. The handler
+// does not authenticate the caller itself, and RouteSSH registers it without
+// any authentication middleware.
+func (h *caHandler) ProvisionerTokens(w http.ResponseWriter, r *http.Request) {
+	subject := r.URL.Query().Get("subject")
+
+	used, err := h.Authority.GetUsedTokens(subject)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+
+	tokens := make([]UsedToken, len(used))
+	for i, u := range used {
+		tokens[i] = UsedToken{ID: u.ID, Subject: u.Subject, UsedAt: u.UsedAt}
+	}
+	JSON(w, &ProvisionerTokensResponse{Tokens: tokens})
+}
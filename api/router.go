@@ -0,0 +1,23 @@
+package api
+
+import "net/http"
+
+// Router registers an HTTP handler against a method and a path pattern.
+// It's satisfied by the mux the CA's main command wires the API up with.
+type Router interface {
+	MethodFunc(method, pattern string, h http.HandlerFunc)
+}
+
+// RouteSSH registers the SSH and provisioner-token endpoints exposed by
+// caHandler. Without this, RevokeSSH, SSHRevocationList, RenewSSH, RekeySSH
+// and ProvisionerTokens are handlers nobody ever calls.
+func (h *caHandler) RouteSSH(r Router) {
+	r.MethodFunc(http.MethodPost, "/ssh/sign", h.SignSSH)
+	r.MethodFunc(http.MethodGet, "/ssh/keys", h.SSHKeys)
+	r.MethodFunc(http.MethodPost, "/ssh/config", h.SSHConfig)
+	r.MethodFunc(http.MethodPost, "/ssh/revoke", h.RevokeSSH)
+	r.MethodFunc(http.MethodGet, "/ssh/krl", h.SSHRevocationList)
+	r.MethodFunc(http.MethodPost, "/ssh/renew", h.RenewSSH)
+	r.MethodFunc(http.MethodPost, "/ssh/rekey", h.RekeySSH)
+	r.MethodFunc(http.MethodGet, "/provisioners/tokens", h.ProvisionerTokens)
+}
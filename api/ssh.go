@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority"
@@ -19,6 +20,10 @@ type SSHAuthority interface {
 	SignSSHAddUser(key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
 	GetSSHKeys() (*authority.SSHKeys, error)
 	GetSSHConfig(typ string, data map[string]string) ([]templates.Output, error)
+	RevokeSSH(cert *ssh.Certificate, reason string, ott string) error
+	GetSSHRevocationList(ca string) ([]byte, uint64, error)
+	RenewSSH(cert *ssh.Certificate, pub ssh.PublicKey) (*ssh.Certificate, error)
+	GetUsedTokens(subject string) ([]authority.UsedToken, error)
 }
 
 // SignSSHRequest is the request body of an SSH certificate request.
@@ -169,6 +174,92 @@ type SSHConfigResponse struct {
 	HostTemplates []Template `json:"hostTemplates,omitempty"`
 }
 
+// RevokeSSHRequest is the request body of an SSH certificate revocation
+// request.
+type RevokeSSHRequest struct {
+	Serial  uint64 `json:"serial,omitempty"`
+	CertB64 []byte `json:"certB64"` //base64 encoded
+	OTT     string `json:"ott"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Validate validates the RevokeSSHRequest.
+func (r *RevokeSSHRequest) Validate() error {
+	switch {
+	case len(r.CertB64) == 0:
+		return errors.New("missing or empty certB64")
+	case len(r.OTT) == 0:
+		return errors.New("missing or empty ott")
+	default:
+		return nil
+	}
+}
+
+// RevokeSSHResponse is the response object returned after a successful SSH
+// certificate revocation.
+type RevokeSSHResponse struct {
+	Status string `json:"status"`
+}
+
+// RevokeSSH is an HTTP handler that revokes the SSH certificate in the
+// request body so that it no longer validates against the CA's KRL.
+func (h *caHandler) RevokeSSH(w http.ResponseWriter, r *http.Request) {
+	var body RevokeSSHRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, BadRequest(errors.Wrap(err, "error reading request body")))
+		return
+	}
+
+	logOtt(w, body.OTT)
+	if err := body.Validate(); err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
+	pub, err := ssh.ParsePublicKey(body.CertB64)
+	if err != nil {
+		WriteError(w, BadRequest(errors.Wrap(err, "error parsing certB64")))
+		return
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		WriteError(w, BadRequest(errors.New("certB64 is not an ssh certificate")))
+		return
+	}
+	if body.Serial != 0 && body.Serial != cert.Serial {
+		WriteError(w, BadRequest(errors.New("serial does not match the certificate in certB64")))
+		return
+	}
+
+	if err := h.Authority.RevokeSSH(cert, body.Reason, body.OTT); err != nil {
+		WriteError(w, Forbidden(err))
+		return
+	}
+
+	JSON(w, &RevokeSSHResponse{Status: "ok"})
+}
+
+// SSHRevocationList is an HTTP handler that returns a signed OpenSSH Key
+// Revocation List (KRL) for the CA selected by the "ca" query parameter
+// ("user" or "host", defaults to "user"). The response can be consumed
+// directly by `ssh-keygen -Q -f` or sshd's RevokedKeys directive.
+func (h *caHandler) SSHRevocationList(w http.ResponseWriter, r *http.Request) {
+	ca := r.URL.Query().Get("ca")
+	if ca == "" {
+		ca = "user"
+	}
+
+	krl, version, err := h.Authority.GetSSHRevocationList(ca)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", strconv.FormatUint(version, 10))
+	w.Write(krl)
+}
+
 // SignSSH is an HTTP handler that reads an SignSSHRequest with a one-time-token
 // (ott) from the body and creates a new SSH certificate with the information in
 // the request.
@@ -237,6 +328,81 @@ func (h *caHandler) SignSSH(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// sshCertificateFromRequest extracts the SSH certificate the caller is
+// presenting in place of an OTT for a renew/rekey request, from the
+// X-SSH-Certificate header. There's no TLS client cert chain to fall back
+// to here: the client authenticates with an SSH certificate, not an x509
+// one, so it never appears in r.TLS.
+func sshCertificateFromRequest(r *http.Request) (*ssh.Certificate, error) {
+	if h := r.Header.Get("X-SSH-Certificate"); h != "" {
+		data, err := base64.StdEncoding.DecodeString(h)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding X-SSH-Certificate header")
+		}
+		pub, err := ssh.ParsePublicKey(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing X-SSH-Certificate header")
+		}
+		cert, ok := pub.(*ssh.Certificate)
+		if !ok {
+			return nil, errors.New("X-SSH-Certificate header is not an ssh certificate")
+		}
+		return cert, nil
+	}
+	return nil, errors.New("missing X-SSH-Certificate header")
+}
+
+// renewOrRekeySSH is the shared implementation of RenewSSH and RekeySSH: both
+// accept a presented SSH certificate in place of an OTT and re-sign it,
+// optionally swapping in a caller-supplied public key for a rekey.
+func (h *caHandler) renewOrRekeySSH(w http.ResponseWriter, r *http.Request, rekey bool) {
+	cert, err := sshCertificateFromRequest(r)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
+	publicKey := cert.Key
+	if rekey {
+		var body SignSSHRequest
+		if err := ReadJSON(r.Body, &body); err != nil {
+			WriteError(w, BadRequest(errors.Wrap(err, "error reading request body")))
+			return
+		}
+		if len(body.PublicKey) == 0 {
+			WriteError(w, BadRequest(errors.New("missing or empty publicKey")))
+			return
+		}
+		publicKey, err = ssh.ParsePublicKey(body.PublicKey)
+		if err != nil {
+			WriteError(w, BadRequest(errors.Wrap(err, "error parsing publicKey")))
+			return
+		}
+	}
+
+	newCert, err := h.Authority.RenewSSH(cert, publicKey)
+	if err != nil {
+		WriteError(w, Forbidden(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	JSON(w, &SignSSHResponse{Certificate: SSHCertificate{newCert}})
+}
+
+// RenewSSH is an HTTP handler that renews the SSH certificate presented by
+// the caller, keeping its public key but issuing fresh validity bounds.
+func (h *caHandler) RenewSSH(w http.ResponseWriter, r *http.Request) {
+	h.renewOrRekeySSH(w, r, false)
+}
+
+// RekeySSH is an HTTP handler like RenewSSH that additionally swaps in the
+// publicKey supplied in the request body, for callers that generate a new
+// key pair on every renewal.
+func (h *caHandler) RekeySSH(w http.ResponseWriter, r *http.Request) {
+	h.renewOrRekeySSH(w, r, true)
+}
+
 // SSHKeys is an HTTP handler that returns the SSH public keys for user and host
 // certificates.
 func (h *caHandler) SSHKeys(w http.ResponseWriter, r *http.Request) {
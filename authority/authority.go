@@ -0,0 +1,114 @@
+package authority
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/nosql"
+	"golang.org/x/crypto/ssh"
+)
+
+// Config is the configuration of the certificate authority.
+type Config struct {
+	AuthorityConfig *AuthorityConfig `json:"authority,omitempty"`
+}
+
+// AuthorityConfig holds the options that configure the Authority itself,
+// rather than any one CA key or provisioner.
+type AuthorityConfig struct {
+	// DisableIssuedAtCheck disables the default rejection of tokens issued
+	// before the authority started. See Authorize.
+	DisableIssuedAtCheck bool `json:"disableIssuedAtCheck,omitempty"`
+	// TokenStore configures the backend used for OTT replay protection.
+	// Defaults to an in-memory store that doesn't survive restarts.
+	TokenStore *TokenStoreConfig `json:"tokenStore,omitempty"`
+}
+
+// Authority implements the Certificate Authority internal interface.
+type Authority struct {
+	config       *Config
+	db           nosql.DB
+	provisioners *provisioner.Collection
+	startTime    time.Time
+
+	tokenStore         TokenStore
+	sshRevocationStore SSHRevocationStore
+	sshUserCertSignKey ssh.Signer
+	sshHostCertSignKey ssh.Signer
+
+	gcCancel context.CancelFunc
+}
+
+// tokenStoreGCInterval is how often the token store is swept for expired
+// entries. Backends that self-expire (redis) treat each sweep as a no-op.
+const tokenStoreGCInterval = 1 * time.Hour
+
+// NewAuthority creates and initializes a new Authority, wiring its
+// persistence-backed stores from config before returning.
+func NewAuthority(config *Config, db nosql.DB, provisioners *provisioner.Collection, sshUserCertSignKey, sshHostCertSignKey ssh.Signer) (*Authority, error) {
+	a := &Authority{
+		config:             config,
+		db:                 db,
+		provisioners:       provisioners,
+		sshUserCertSignKey: sshUserCertSignKey,
+		sshHostCertSignKey: sshHostCertSignKey,
+	}
+	if err := a.init(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// init wires up the stores that depend on the authority's configuration and
+// database. It's split out from NewAuthority so tests can construct an
+// Authority and re-run just this step after adjusting config.
+func (a *Authority) init() error {
+	a.startTime = time.Now()
+
+	var tsConfig *TokenStoreConfig
+	if a.config != nil && a.config.AuthorityConfig != nil {
+		tsConfig = a.config.AuthorityConfig.TokenStore
+	}
+	tokenStore, err := newTokenStore(tsConfig, a.db)
+	if err != nil {
+		return errors.Wrap(err, "error initializing token store")
+	}
+	a.tokenStore = tokenStore
+
+	sshRevocationStore, err := newBoltSSHRevocationStore(a.db)
+	if err != nil {
+		return errors.Wrap(err, "error initializing ssh revocation store")
+	}
+	a.sshRevocationStore = sshRevocationStore
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.gcCancel = cancel
+	go a.runTokenStoreGC(ctx)
+
+	return nil
+}
+
+// runTokenStoreGC calls TokenStore.GC on a fixed interval until ctx is
+// canceled. Without this, GC is implemented on every backend but nothing
+// ever calls it, so the bolt-backed table grows without bound.
+func (a *Authority) runTokenStoreGC(ctx context.Context) {
+	ticker := time.NewTicker(tokenStoreGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = a.tokenStore.GC(ctx)
+		}
+	}
+}
+
+// Shutdown stops the authority's background maintenance goroutines.
+func (a *Authority) Shutdown() {
+	if a.gcCancel != nil {
+		a.gcCancel()
+	}
+}
@@ -12,8 +12,10 @@ import (
 )
 
 type idUsed struct {
-	UsedAt  int64  `json:"ua,omitempty"`
-	Subject string `json:"sub,omitempty"`
+	ID        string `json:"jti,omitempty"`
+	UsedAt    int64  `json:"ua,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
 }
 
 // Claims extends jose.Claims with step attributes.
@@ -53,7 +55,6 @@ func stripPort(rawurl string) string {
 
 // Authorize authorizes a signature request by validating and authenticating
 // a OTT that must be sent w/ the request.
-// TODO(mariano): protection against reuse for oidc
 func (a *Authority) Authorize(ott string) ([]provisioner.SignOption, error) {
 	var errContext = map[string]interface{}{"ott": ott}
 
@@ -88,12 +89,20 @@ func (a *Authority) Authorize(ott string) ([]provisioner.SignOption, error) {
 			http.StatusUnauthorized, errContext}
 	}
 
-	// Store the token to protect against reuse.
-	if p.GetType() == provisioner.TypeJWK && claims.ID != "" {
-		if _, ok := a.ottMap.LoadOrStore(claims.ID, &idUsed{
-			UsedAt:  time.Now().Unix(),
-			Subject: claims.Subject,
-		}); ok {
+	// Store the token to protect against reuse. This applies to any
+	// provisioner type whose token carries a jti, not just JWK ones, so that
+	// e.g. OIDC-issued tokens are covered too.
+	if claims.ID != "" {
+		ttl := time.Hour
+		if claims.Expiry != nil {
+			if d := time.Until(claims.Expiry.Time()); d > 0 {
+				ttl = d
+			}
+		}
+		if _, stored, err := a.tokenStore.LoadOrStore(claims.ID, time.Now(), claims.Subject, ttl); err != nil {
+			return nil, &apiError{errors.Wrap(err, "authorize: error storing token"),
+				http.StatusInternalServerError, errContext}
+		} else if !stored {
 			return nil, &apiError{errors.Errorf("token already used"), http.StatusUnauthorized,
 				errContext}
 		}
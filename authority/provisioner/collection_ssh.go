@@ -0,0 +1,37 @@
+package provisioner
+
+import "golang.org/x/crypto/ssh"
+
+// LoadBySSHCertificate looks up the provisioner that issued cert, the SSH
+// analogue of LoadByCertificate: the provisioner id travels in the
+// certificate's step SSH extension, falling back to KeyId for certificates
+// issued before that extension carried one.
+func (c *Collection) LoadBySSHCertificate(cert *ssh.Certificate) (Interface, bool) {
+	if ext, ok := DecodeStepSSHExtension(cert); ok && ext.ProvisionerID != "" {
+		if p, ok := c.LoadByID(ext.ProvisionerID); ok {
+			return p, true
+		}
+	}
+	return c.LoadByID(cert.KeyId)
+}
+
+// sshRenewalAuthorizer is implemented by provisioner types that enforce
+// their own policy on SSH renewals, mirroring AuthorizeRenewal on the x509
+// side. It's declared separately, rather than added to Interface directly,
+// so that existing provisioner types don't all have to grow a method they
+// don't care about: AuthorizeSSHRenewal falls back to allowing the renewal
+// for any provisioner that doesn't opt in by implementing it.
+type sshRenewalAuthorizer interface {
+	AuthorizeSSHRenewal(cert *ssh.Certificate) error
+}
+
+// AuthorizeSSHRenewal checks whether p allows cert to be renewed. Most
+// provisioner types don't implement sshRenewalAuthorizer and renewal is
+// allowed by default, the same fallback authorizeRenewal uses for x509
+// certificates whose provisioner can't enforce a policy either.
+func AuthorizeSSHRenewal(p Interface, cert *ssh.Certificate) error {
+	if a, ok := p.(sshRenewalAuthorizer); ok {
+		return a.AuthorizeSSHRenewal(cert)
+	}
+	return nil
+}
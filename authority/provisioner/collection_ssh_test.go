@@ -0,0 +1,39 @@
+package provisioner
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// plainProvisioner embeds a nil Interface so it satisfies the type without
+// implementing any method itself; tests never call through the embedded
+// Interface, only type-assert against sshRenewalAuthorizer.
+type plainProvisioner struct {
+	Interface
+}
+
+type sshRenewalPolicyProvisioner struct {
+	Interface
+	err error
+}
+
+func (p *sshRenewalPolicyProvisioner) AuthorizeSSHRenewal(cert *ssh.Certificate) error {
+	return p.err
+}
+
+func TestAuthorizeSSHRenewal_DefaultsToAllowed(t *testing.T) {
+	p := &plainProvisioner{}
+	if err := AuthorizeSSHRenewal(p, &ssh.Certificate{}); err != nil {
+		t.Errorf("AuthorizeSSHRenewal() error = %v, want nil for a provisioner with no opinion", err)
+	}
+}
+
+func TestAuthorizeSSHRenewal_DefersToProvisioner(t *testing.T) {
+	want := errors.New("renewal denied by policy")
+	p := &sshRenewalPolicyProvisioner{err: want}
+	if err := AuthorizeSSHRenewal(p, &ssh.Certificate{}); err != want {
+		t.Errorf("AuthorizeSSHRenewal() error = %v, want %v", err, want)
+	}
+}
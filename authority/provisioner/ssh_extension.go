@@ -0,0 +1,70 @@
+package provisioner
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// StepSSHExtensionKey is the key under which a StepSSHExtension is stored in
+// an SSH certificate's non-critical permission extensions.
+const StepSSHExtensionKey = "step-ssh-extension@smallstep.com"
+
+// StepSSHExtension is the step-specific extension embedded in the
+// permissions of an SSH certificate whose provisioner sets it. It travels with the
+// certificate so that a later renew/rekey request can be bounded without a
+// round trip to the original provisioner.
+//
+// A provisioner that wants to bound renewals calls Apply when it builds the
+// certificate to sign, e.g. from its SignSSH SignOption chain; RenewSSH
+// reads it back via DecodeStepSSHExtension on every renewal.
+type StepSSHExtension struct {
+	// Renewable indicates whether the certificate may be renewed or rekeyed
+	// at all. Provisioners that issue single-use host certificates, for
+	// example, will want to set this to false.
+	Renewable bool `json:"renewable"`
+	// MaxRenewals caps the number of times a certificate descended from the
+	// original may be renewed. Zero means unlimited.
+	MaxRenewals int `json:"maxRenewals,omitempty"`
+	// Renewals counts how many times a certificate descended from the
+	// original has already been renewed. Compared against MaxRenewals to
+	// bound the chain; callers other than RenewSSH should leave it at zero.
+	Renewals int `json:"renewals,omitempty"`
+	// ProvisionerID is the id of the provisioner that issued the
+	// certificate, so Collection.LoadBySSHCertificate can look it back up
+	// without a database round trip, the SSH analogue of the x509 step
+	// extension LoadByCertificate reads.
+	ProvisionerID string `json:"provisionerId,omitempty"`
+}
+
+// Apply encodes e and stores it in cert's permission extensions, creating
+// the Extensions map if necessary.
+func (e StepSSHExtension) Apply(cert *ssh.Certificate) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling step ssh extension")
+	}
+	if cert.Permissions.Extensions == nil {
+		cert.Permissions.Extensions = make(map[string]string)
+	}
+	cert.Permissions.Extensions[StepSSHExtensionKey] = string(b)
+	return nil
+}
+
+// DecodeStepSSHExtension reads the StepSSHExtension embedded in cert's
+// permission extensions, if any. ok is false if cert carries no such
+// extension (e.g. it was issued before this feature existed, or by a
+// provisioner that doesn't set it), in which case callers should authorize
+// the renewal by default, the same fallback authorizeRenewal uses for x509
+// certificates whose step extension can't be found.
+func DecodeStepSSHExtension(cert *ssh.Certificate) (ext StepSSHExtension, ok bool) {
+	v, found := cert.Permissions.Extensions[StepSSHExtensionKey]
+	if !found {
+		return StepSSHExtension{}, false
+	}
+	if err := json.Unmarshal([]byte(v), &ext); err != nil {
+		return StepSSHExtension{}, false
+	}
+	return ext, true
+}
@@ -0,0 +1,44 @@
+package provisioner
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestStepSSHExtension_ApplyDecodeRoundTrip(t *testing.T) {
+	cert := &ssh.Certificate{}
+	want := StepSSHExtension{Renewable: true, MaxRenewals: 3, Renewals: 1}
+
+	if err := want.Apply(cert); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	got, ok := DecodeStepSSHExtension(cert)
+	if !ok {
+		t.Fatalf("DecodeStepSSHExtension() ok = false, want true")
+	}
+	if got != want {
+		t.Errorf("DecodeStepSSHExtension() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeStepSSHExtension_Missing(t *testing.T) {
+	cert := &ssh.Certificate{}
+
+	if _, ok := DecodeStepSSHExtension(cert); ok {
+		t.Errorf("DecodeStepSSHExtension() ok = true for a certificate with no extension, want false")
+	}
+}
+
+func TestDecodeStepSSHExtension_Malformed(t *testing.T) {
+	cert := &ssh.Certificate{
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{StepSSHExtensionKey: "not-json"},
+		},
+	}
+
+	if _, ok := DecodeStepSSHExtension(cert); ok {
+		t.Errorf("DecodeStepSSHExtension() ok = true for a malformed extension, want false")
+	}
+}
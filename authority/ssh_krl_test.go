@@ -0,0 +1,104 @@
+package authority
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func mustSSHSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("ssh.NewSignerFromKey() error = %v", err)
+	}
+	return signer
+}
+
+func TestEncodeSSHKRL_Header(t *testing.T) {
+	signer := mustSSHSigner(t)
+	revoked := []sshRevokedCert{{Serial: 7}, {Serial: 42}}
+
+	b := encodeSSHKRL(3, signer.PublicKey(), revoked)
+
+	if got := string(b[:len(krlMagic)]); got != krlMagic {
+		t.Fatalf("magic = %q, want %q", got, krlMagic)
+	}
+	rest := b[len(krlMagic):]
+	if got := binary.BigEndian.Uint32(rest[:4]); got != krlFormatVersion {
+		t.Errorf("format version = %d, want %d", got, krlFormatVersion)
+	}
+	rest = rest[4:]
+	if got := binary.BigEndian.Uint64(rest[:8]); got != 3 {
+		t.Errorf("krl version = %d, want 3", got)
+	}
+}
+
+func TestEncodeSSHKRL_CertSectionContainsRevokedSerials(t *testing.T) {
+	signer := mustSSHSigner(t)
+	revoked := []sshRevokedCert{{Serial: 7}, {Serial: 42}}
+
+	b := encodeSSHKRL(1, signer.PublicKey(), revoked)
+
+	// Skip the fixed header (magic + 4 uint32/uint64 fields + empty comment
+	// string) to find the start of the certificates section.
+	off := len(krlMagic) + 4 + 8 + 8 + 8 + 4
+
+	typ := b[off]
+	if typ != krlSectionCertificates {
+		t.Fatalf("section type = %d, want %d", typ, krlSectionCertificates)
+	}
+	off++
+	sectionLen := binary.BigEndian.Uint32(b[off : off+4])
+	off += 4
+	section := b[off : off+int(sectionLen)]
+
+	// section = string(caKeyBlob) + subsection(0x20, serials...)
+	caKeyLen := binary.BigEndian.Uint32(section[:4])
+	pos := 4 + int(caKeyLen)
+	subType := section[pos]
+	if subType != krlCertSectionSerialList {
+		t.Fatalf("cert sub-section type = %d, want %d", subType, krlCertSectionSerialList)
+	}
+	pos++
+	subLen := binary.BigEndian.Uint32(section[pos : pos+4])
+	pos += 4
+	serialBytes := section[pos : pos+int(subLen)]
+
+	if len(serialBytes) != len(revoked)*8 {
+		t.Fatalf("serial list length = %d, want %d", len(serialBytes), len(revoked)*8)
+	}
+	for i, rc := range revoked {
+		got := binary.BigEndian.Uint64(serialBytes[i*8 : i*8+8])
+		if got != rc.Serial {
+			t.Errorf("serial[%d] = %d, want %d", i, got, rc.Serial)
+		}
+	}
+}
+
+func TestSignSSHKRL(t *testing.T) {
+	signer := mustSSHSigner(t)
+	unsigned := encodeSSHKRL(1, signer.PublicKey(), nil)
+
+	signed, err := signSSHKRL(unsigned, signer)
+	if err != nil {
+		t.Fatalf("signSSHKRL() error = %v", err)
+	}
+
+	if len(signed) <= len(unsigned) {
+		t.Fatalf("signed KRL (%d bytes) is not longer than unsigned (%d bytes)", len(signed), len(unsigned))
+	}
+	if string(signed[:len(unsigned)]) != string(unsigned) {
+		t.Errorf("signed KRL does not start with the unsigned bytes")
+	}
+	if typ := signed[len(unsigned)]; typ != krlSectionSignature {
+		t.Errorf("trailing section type = %d, want %d (signature)", typ, krlSectionSignature)
+	}
+}
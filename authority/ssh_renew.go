@@ -0,0 +1,164 @@
+package authority
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"golang.org/x/crypto/ssh"
+)
+
+// verifySSHCertificateSignature checks that cert was actually signed by this
+// authority's own SSH user or host key, using ssh.CertChecker so that the
+// cryptographic signature, and not just the wire-decoded fields, is
+// validated. Every field read off cert elsewhere (KeyId, ValidPrincipals,
+// ValidBefore, Permissions, ...) is only trustworthy once this has passed:
+// ssh.ParsePublicKey alone decodes a certificate without verifying it.
+func (a *Authority) verifySSHCertificateSignature(cert *ssh.Certificate) error {
+	var signer ssh.Signer
+	switch cert.CertType {
+	case ssh.UserCert:
+		signer = a.sshUserCertSignKey
+	case ssh.HostCert:
+		signer = a.sshHostCertSignKey
+	default:
+		return errors.Errorf("unsupported ssh certificate type %d", cert.CertType)
+	}
+	if signer == nil {
+		return errors.New("authority has no ssh key configured for this certificate type")
+	}
+	caKey := signer.PublicKey()
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return cert.CertType == ssh.UserCert && bytes.Equal(auth.Marshal(), caKey.Marshal())
+		},
+		IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+			return cert.CertType == ssh.HostCert && bytes.Equal(auth.Marshal(), caKey.Marshal())
+		},
+	}
+
+	var principal string
+	if len(cert.ValidPrincipals) > 0 {
+		principal = cert.ValidPrincipals[0]
+	}
+	if err := checker.CheckCert(principal, cert); err != nil {
+		return errors.Wrap(err, "error verifying presented ssh certificate")
+	}
+	return nil
+}
+
+// authorizeSSHRenewal mirrors authorizeRenewal for the SSH side: it verifies
+// cert was actually signed by this authority, locates the provisioner that
+// issued it via its step SSH extension or KeyId (the SSH analogue of
+// LoadByCertificate), makes sure cert hasn't been revoked, checks any
+// renewal bound carried in its step extension, and defers to the
+// provisioner's own renewal policy.
+func (a *Authority) authorizeSSHRenewal(cert *ssh.Certificate) error {
+	errContext := map[string]interface{}{"serial": cert.Serial}
+
+	if err := a.verifySSHCertificateSignature(cert); err != nil {
+		return &apiError{err: err, code: http.StatusUnauthorized, context: errContext}
+	}
+
+	p, ok := a.provisioners.LoadBySSHCertificate(cert)
+	if !ok {
+		return &apiError{
+			err:     errors.New("provisioner not found"),
+			code:    http.StatusUnauthorized,
+			context: errContext,
+		}
+	}
+
+	caKey := "user"
+	if cert.CertType == ssh.HostCert {
+		caKey = "host"
+	}
+	if revoked, err := a.sshRevocationStore.IsRevoked(caKey, cert.Serial); err != nil {
+		return &apiError{err: err, code: http.StatusInternalServerError, context: errContext}
+	} else if revoked {
+		return &apiError{
+			err:     errors.New("ssh certificate has been revoked"),
+			code:    http.StatusUnauthorized,
+			context: errContext,
+		}
+	}
+
+	// If the certificate carries a step SSH extension, it bounds whether,
+	// and how many more times, it may be renewed. A certificate without the
+	// extension (e.g. issued before this feature existed) renews unbounded
+	// by default, the same fallback authorizeRenewal uses for x509 certs.
+	if ext, found := provisioner.DecodeStepSSHExtension(cert); found {
+		if !ext.Renewable {
+			return &apiError{
+				err:     errors.New("ssh certificate is not renewable"),
+				code:    http.StatusUnauthorized,
+				context: errContext,
+			}
+		}
+		if ext.MaxRenewals > 0 && ext.Renewals >= ext.MaxRenewals {
+			return &apiError{
+				err:     errors.Errorf("ssh certificate has reached its maximum of %d renewals", ext.MaxRenewals),
+				code:    http.StatusUnauthorized,
+				context: errContext,
+			}
+		}
+	}
+
+	if err := provisioner.AuthorizeSSHRenewal(p, cert); err != nil {
+		return &apiError{err: err, code: http.StatusUnauthorized, context: errContext}
+	}
+	return nil
+}
+
+// RenewSSH renews cert, re-signing pub with the same KeyId, principals and
+// duration as the original but with fresh ValidAfter/ValidBefore bounds. For
+// a plain renewal pub is cert.Key; for a rekey it's the new key supplied by
+// the caller.
+func (a *Authority) RenewSSH(cert *ssh.Certificate, pub ssh.PublicKey) (*ssh.Certificate, error) {
+	if err := a.authorizeSSHRenewal(cert); err != nil {
+		return nil, err
+	}
+
+	duration := time.Duration(cert.ValidBefore-cert.ValidAfter) * time.Second
+	validAfter := time.Now()
+	validBefore := validAfter.Add(duration)
+
+	newCert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          cert.Serial,
+		CertType:        cert.CertType,
+		KeyId:           cert.KeyId,
+		ValidPrincipals: cert.ValidPrincipals,
+		ValidAfter:      uint64(validAfter.Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+		Permissions:     cert.Permissions,
+	}
+
+	// Carry the step SSH extension forward, with its renewal count bumped,
+	// so a chain of renewals stays bounded by the original MaxRenewals.
+	if ext, found := provisioner.DecodeStepSSHExtension(cert); found {
+		ext.Renewals++
+		if err := ext.Apply(newCert); err != nil {
+			return nil, err
+		}
+	}
+
+	caKey := "user"
+	signer := a.sshUserCertSignKey
+	if cert.CertType == ssh.HostCert {
+		caKey = "host"
+		signer = a.sshHostCertSignKey
+	}
+	if signer == nil {
+		return nil, errors.Errorf("authority has no %s ssh key configured", caKey)
+	}
+
+	if err := newCert.SignCert(rand.Reader, signer); err != nil {
+		return nil, errors.Wrap(err, "error signing renewed ssh certificate")
+	}
+	return newCert, nil
+}
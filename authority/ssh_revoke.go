@@ -0,0 +1,241 @@
+package authority
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/cli/jose"
+	"github.com/smallstep/nosql"
+	"golang.org/x/crypto/ssh"
+)
+
+// revokedSSHCertsUserTable and revokedSSHCertsHostTable hold revoked serials
+// for user and host certificates respectively, kept apart because a KRL is
+// generated and signed per CA key, not for the authority as a whole.
+var (
+	revokedSSHCertsUserTable = []byte("ssh_revoked_certs_user")
+	revokedSSHCertsHostTable = []byte("ssh_revoked_certs_host")
+)
+
+// sshRevokedCert is the value persisted for every revoked SSH certificate.
+type sshRevokedCert struct {
+	Serial    uint64 `json:"serial"`
+	Reason    string `json:"reason"`
+	RevokedAt int64  `json:"revokedAt"`
+}
+
+// SSHRevocationStore is implemented by the backends that persist revoked SSH
+// certificate serials, keyed by the CA ("user" or "host") that issued them.
+// It plays the same role for SSH certificates that the x509 revocation table
+// plays for x509 ones.
+type SSHRevocationStore interface {
+	// Revoke records serial as revoked for caKey. It returns an error if the
+	// serial was already revoked.
+	Revoke(caKey string, serial uint64, reason string) error
+	// IsRevoked reports whether serial has been revoked for caKey.
+	IsRevoked(caKey string, serial uint64) (bool, error)
+	// List returns every certificate revoked for caKey, along with the
+	// version to use for the KRL built from it.
+	List(caKey string) (version uint64, revoked []sshRevokedCert, err error)
+}
+
+// boltSSHRevocationStore is the default SSHRevocationStore, backed by the
+// same nosql.DB the authority already opens for x509 revocation.
+type boltSSHRevocationStore struct {
+	db nosql.DB
+}
+
+func newBoltSSHRevocationStore(db nosql.DB) (*boltSSHRevocationStore, error) {
+	if err := db.CreateTable(revokedSSHCertsUserTable); err != nil {
+		return nil, errors.Wrap(err, "error creating ssh user revocation table")
+	}
+	if err := db.CreateTable(revokedSSHCertsHostTable); err != nil {
+		return nil, errors.Wrap(err, "error creating ssh host revocation table")
+	}
+	return &boltSSHRevocationStore{db: db}, nil
+}
+
+func sshRevocationTable(caKey string) ([]byte, error) {
+	switch caKey {
+	case "user":
+		return revokedSSHCertsUserTable, nil
+	case "host":
+		return revokedSSHCertsHostTable, nil
+	default:
+		return nil, errors.Errorf("unsupported ca %s, must be user or host", caKey)
+	}
+}
+
+func serialKey(serial uint64) []byte {
+	return []byte(strconv.FormatUint(serial, 10))
+}
+
+// Revoke implements SSHRevocationStore.
+func (s *boltSSHRevocationStore) Revoke(caKey string, serial uint64, reason string) error {
+	table, err := sshRevocationTable(caKey)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(&sshRevokedCert{
+		Serial:    serial,
+		Reason:    reason,
+		RevokedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error marshaling revoked ssh certificate")
+	}
+
+	if _, swapped, err := s.db.CmpAndSwap(table, serialKey(serial), nil, b); err != nil {
+		return errors.Wrap(err, "error storing revoked ssh certificate")
+	} else if !swapped {
+		return errors.Errorf("ssh certificate with serial %d is already revoked", serial)
+	}
+	return nil
+}
+
+// IsRevoked implements SSHRevocationStore.
+func (s *boltSSHRevocationStore) IsRevoked(caKey string, serial uint64) (bool, error) {
+	table, err := sshRevocationTable(caKey)
+	if err != nil {
+		return false, err
+	}
+
+	switch _, err := s.db.Get(table, serialKey(serial)); err {
+	case nil:
+		return true, nil
+	case nosql.ErrNotFound:
+		return false, nil
+	default:
+		return false, errors.Wrap(err, "error reading revoked ssh certificate")
+	}
+}
+
+// List implements SSHRevocationStore.
+func (s *boltSSHRevocationStore) List(caKey string) (uint64, []sshRevokedCert, error) {
+	table, err := sshRevocationTable(caKey)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	entries, err := s.db.List(table)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "error listing revoked ssh certificates")
+	}
+
+	revoked := make([]sshRevokedCert, 0, len(entries))
+	var version uint64
+	for _, e := range entries {
+		var rc sshRevokedCert
+		if err := json.Unmarshal(e.Value, &rc); err != nil {
+			return 0, nil, errors.Wrap(err, "error unmarshaling revoked ssh certificate")
+		}
+		revoked = append(revoked, rc)
+		if uint64(rc.RevokedAt) > version {
+			version = uint64(rc.RevokedAt)
+		}
+	}
+	return version, revoked, nil
+}
+
+// RevokeSSH revokes cert so that it no longer validates against the CA's
+// KRL. ott must be a valid, unexpired token whose subject matches cert's
+// KeyId or one of its principals, i.e. the caller must be able to
+// authenticate as the identity the certificate was issued to; it is not
+// enough to hold any valid OTT from any provisioner, or revocation would let
+// any authenticated caller revoke anyone else's certificate. reason is
+// recorded for audit purposes.
+func (a *Authority) RevokeSSH(cert *ssh.Certificate, reason string, ott string) error {
+	errContext := map[string]interface{}{"serial": cert.Serial}
+
+	if err := a.verifySSHCertificateSignature(cert); err != nil {
+		return &apiError{err: err, code: http.StatusUnauthorized, context: errContext}
+	}
+
+	// Authorize authenticates ott (and consumes it against replay) but its
+	// SignOptions are for issuing a new certificate, not for revocation, so
+	// they're discarded; the claims are re-read below to get the subject.
+	if _, err := a.Authorize(ott); err != nil {
+		return err
+	}
+
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return &apiError{errors.Wrap(err, "revokeSSH: error parsing token"), http.StatusUnauthorized, errContext}
+	}
+	var claims Claims
+	if err := token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return &apiError{err, http.StatusUnauthorized, errContext}
+	}
+
+	if !sshCertMatchesSubject(cert, claims.Subject) {
+		return &apiError{
+			err:     errors.Errorf("token subject %q is not authorized to revoke this certificate", claims.Subject),
+			code:    http.StatusUnauthorized,
+			context: errContext,
+		}
+	}
+
+	caKey := "user"
+	if cert.CertType == ssh.HostCert {
+		caKey = "host"
+	}
+	return a.sshRevocationStore.Revoke(caKey, cert.Serial, reason)
+}
+
+// sshCertMatchesSubject reports whether subject identifies cert: either its
+// KeyId (the identity the provisioner certified when it was issued) or one
+// of its principals.
+func sshCertMatchesSubject(cert *ssh.Certificate, subject string) bool {
+	if subject == "" {
+		return false
+	}
+	if cert.KeyId == subject {
+		return true
+	}
+	for _, p := range cert.ValidPrincipals {
+		if p == subject {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSSHRevocationList returns a signed OpenSSH Key Revocation List for the
+// requested CA ("user" or "host"), along with the KRL version to use as an
+// ETag so clients can cache it.
+func (a *Authority) GetSSHRevocationList(caKey string) ([]byte, uint64, error) {
+	version, revoked, err := a.sshRevocationStore.List(caKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys, err := a.GetSSHKeys()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var pub ssh.PublicKey
+	var signer ssh.Signer
+	switch caKey {
+	case "user":
+		pub, signer = keys.UserKey, a.sshUserCertSignKey
+	case "host":
+		pub, signer = keys.HostKey, a.sshHostCertSignKey
+	default:
+		return nil, 0, errors.Errorf("unsupported ca %s, must be user or host", caKey)
+	}
+	if pub == nil || signer == nil {
+		return nil, 0, errors.Errorf("authority has no %s ssh key configured", caKey)
+	}
+
+	unsigned := encodeSSHKRL(version, pub, revoked)
+	signed, err := signSSHKRL(unsigned, signer)
+	if err != nil {
+		return nil, 0, err
+	}
+	return signed, version, nil
+}
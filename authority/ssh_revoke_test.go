@@ -0,0 +1,30 @@
+package authority
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHCertMatchesSubject(t *testing.T) {
+	cert := &ssh.Certificate{
+		KeyId:           "alice@example.com",
+		ValidPrincipals: []string{"alice", "ops"},
+	}
+
+	cases := []struct {
+		subject string
+		want    bool
+	}{
+		{"alice@example.com", true}, // matches KeyId
+		{"alice", true},             // matches a principal
+		{"ops", true},               // matches a principal
+		{"mallory", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if got := sshCertMatchesSubject(cert, c.subject); got != c.want {
+			t.Errorf("sshCertMatchesSubject(%q) = %v, want %v", c.subject, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package authority
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+// TokenStore protects against OTT replay by recording each token's jti the
+// first time it's seen. Unlike the sync.Map it replaces, the bolt/redis
+// implementations persist across restarts and are shared by every CA replica
+// pointed at the same store; the in-memory implementation does neither.
+type TokenStore interface {
+	// LoadOrStore records jti as used at usedAt for subject, expiring the
+	// record after ttl. If jti was already stored, stored is false and
+	// existing holds the previously recorded value.
+	LoadOrStore(jti string, usedAt time.Time, subject string, ttl time.Duration) (existing *idUsed, stored bool, err error)
+	// List returns the tokens recorded for subject, or every token recorded
+	// if subject is empty. It's best-effort, for operators inspecting
+	// recent activity during incident response, not a hot path.
+	List(subject string) ([]idUsed, error)
+	// GC removes expired entries. Backends that self-expire (e.g. Redis
+	// TTLs) can make this a no-op.
+	GC(ctx context.Context) error
+}
+
+// UsedToken is the exported view of a recorded token jti, returned by
+// GetUsedTokens for the GET /provisioners/tokens admin endpoint.
+type UsedToken struct {
+	ID      string `json:"id"`
+	UsedAt  int64  `json:"usedAt"`
+	Subject string `json:"subject"`
+}
+
+// GetUsedTokens returns the recently used one-time-tokens recorded for
+// subject (or all of them, if subject is empty), for the
+// GET /provisioners/tokens admin endpoint used during incident response.
+func (a *Authority) GetUsedTokens(subject string) ([]UsedToken, error) {
+	used, err := a.tokenStore.List(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]UsedToken, len(used))
+	for i, u := range used {
+		tokens[i] = UsedToken{ID: u.ID, UsedAt: u.UsedAt, Subject: u.Subject}
+	}
+	return tokens, nil
+}
+
+// newTokenStore builds the TokenStore configured by c, defaulting to the
+// original in-memory behavior when c is nil.
+func newTokenStore(c *TokenStoreConfig, db nosql.DB) (TokenStore, error) {
+	if c == nil {
+		return newMemoryTokenStore(), nil
+	}
+	switch c.Type {
+	case "", "memory":
+		return newMemoryTokenStore(), nil
+	case "bolt", "badger":
+		return newBoltTokenStore(db)
+	case "redis":
+		return newRedisTokenStore(c.Address, c.Password, c.DB)
+	default:
+		return nil, errors.Errorf("unsupported token store type %s", c.Type)
+	}
+}
+
+// TokenStoreConfig configures the TokenStore used for OTT replay protection.
+// Type may be "memory" (the default), "bolt"/"badger", or "redis"; Address,
+// Password and DB are only used by the redis backend.
+type TokenStoreConfig struct {
+	Type     string `json:"type"`
+	Address  string `json:"address,omitempty"`
+	Password string `json:"password,omitempty"`
+	DB       int    `json:"db,omitempty"`
+}
+
+// memoryTokenStore is the original behavior: an in-process sync.Map that
+// does not survive restarts and is not shared across replicas.
+type memoryTokenStore struct {
+	m sync.Map
+}
+
+func newMemoryTokenStore() *memoryTokenStore {
+	return &memoryTokenStore{}
+}
+
+func (s *memoryTokenStore) LoadOrStore(jti string, usedAt time.Time, subject string, ttl time.Duration) (*idUsed, bool, error) {
+	v, loaded := s.m.LoadOrStore(jti, &idUsed{ID: jti, UsedAt: usedAt.Unix(), Subject: subject, ExpiresAt: tokenExpiry(usedAt, ttl)})
+	if loaded {
+		existing, _ := v.(*idUsed)
+		return existing, false, nil
+	}
+	return nil, true, nil
+}
+
+func (s *memoryTokenStore) List(subject string) ([]idUsed, error) {
+	var out []idUsed
+	s.m.Range(func(_, v interface{}) bool {
+		if u, ok := v.(*idUsed); ok && (subject == "" || u.Subject == subject) {
+			out = append(out, *u)
+		}
+		return true
+	})
+	return out, nil
+}
+
+func (s *memoryTokenStore) GC(ctx context.Context) error {
+	now := time.Now()
+	s.m.Range(func(k, v interface{}) bool {
+		if u, ok := v.(*idUsed); ok && isTokenExpired(*u, now) {
+			s.m.Delete(k)
+		}
+		return true
+	})
+	return nil
+}
+
+// usedTokenTable is the nosql bucket persisted tokens are stored in.
+var usedTokenTable = []byte("used_ott")
+
+// boltTokenStore persists used token ids to the authority's nosql.DB so
+// replay protection survives restarts and is shared by every CA replica
+// pointed at the same database.
+type boltTokenStore struct {
+	db nosql.DB
+}
+
+func newBoltTokenStore(db nosql.DB) (*boltTokenStore, error) {
+	if err := db.CreateTable(usedTokenTable); err != nil {
+		return nil, errors.Wrap(err, "error creating token store table")
+	}
+	return &boltTokenStore{db: db}, nil
+}
+
+func (s *boltTokenStore) LoadOrStore(jti string, usedAt time.Time, subject string, ttl time.Duration) (*idUsed, bool, error) {
+	used := &idUsed{ID: jti, UsedAt: usedAt.Unix(), Subject: subject, ExpiresAt: tokenExpiry(usedAt, ttl)}
+	b, err := json.Marshal(used)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "error marshaling used token")
+	}
+
+	if _, swapped, err := s.db.CmpAndSwap(usedTokenTable, []byte(jti), nil, b); err != nil {
+		return nil, false, errors.Wrap(err, "error storing used token")
+	} else if swapped {
+		return nil, true, nil
+	}
+
+	raw, err := s.db.Get(usedTokenTable, []byte(jti))
+	if err != nil {
+		return nil, false, errors.Wrap(err, "error loading used token")
+	}
+	var existing idUsed
+	if err := json.Unmarshal(raw, &existing); err != nil {
+		return nil, false, errors.Wrap(err, "error unmarshaling used token")
+	}
+	return &existing, false, nil
+}
+
+func (s *boltTokenStore) List(subject string) ([]idUsed, error) {
+	entries, err := s.db.List(usedTokenTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing used tokens")
+	}
+
+	out := make([]idUsed, 0, len(entries))
+	for _, e := range entries {
+		var u idUsed
+		if err := json.Unmarshal(e.Value, &u); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling used token")
+		}
+		if subject == "" || u.Subject == subject {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+func (s *boltTokenStore) GC(ctx context.Context) error {
+	entries, err := s.db.List(usedTokenTable)
+	if err != nil {
+		return errors.Wrap(err, "error listing used tokens")
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		var u idUsed
+		if err := json.Unmarshal(e.Value, &u); err != nil {
+			continue
+		}
+		if isTokenExpired(u, now) {
+			if err := s.db.Del(usedTokenTable, e.Key); err != nil {
+				return errors.Wrap(err, "error deleting expired used token")
+			}
+		}
+	}
+	return nil
+}
+
+// tokenExpiry computes the absolute expiry, as a unix timestamp, of a token
+// used at usedAt with the given ttl. A non-positive ttl means no expiry.
+func tokenExpiry(usedAt time.Time, ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return usedAt.Add(ttl).Unix()
+}
+
+// isTokenExpired reports whether u's recorded ttl (persisted as ExpiresAt by
+// LoadOrStore) has elapsed as of now. Entries with no ExpiresAt (ttl <= 0
+// when stored) never expire.
+func isTokenExpired(u idUsed, now time.Time) bool {
+	return u.ExpiresAt > 0 && u.ExpiresAt <= now.Unix()
+}
+
+// redisTokenStore is the TokenStore for multi-replica deployments: SET NX
+// plus a TTL gives atomic de-duplication and self-expiry without a GC pass.
+type redisTokenStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func newRedisTokenStore(addr, password string, db int) (*redisTokenStore, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: password, DB: db})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, errors.Wrap(err, "error connecting to redis token store")
+	}
+	return &redisTokenStore{client: client, prefix: "step-ca:ott:"}, nil
+}
+
+func (s *redisTokenStore) LoadOrStore(jti string, usedAt time.Time, subject string, ttl time.Duration) (*idUsed, bool, error) {
+	used := &idUsed{ID: jti, UsedAt: usedAt.Unix(), Subject: subject}
+	b, err := json.Marshal(used)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "error marshaling used token")
+	}
+
+	ctx := context.Background()
+	ok, err := s.client.SetNX(ctx, s.prefix+jti, b, ttl).Result()
+	if err != nil {
+		return nil, false, errors.Wrap(err, "error storing used token in redis")
+	}
+	if ok {
+		return nil, true, nil
+	}
+
+	raw, err := s.client.Get(ctx, s.prefix+jti).Bytes()
+	if err != nil {
+		return nil, false, errors.Wrap(err, "error loading used token from redis")
+	}
+	var existing idUsed
+	if err := json.Unmarshal(raw, &existing); err != nil {
+		return nil, false, errors.Wrap(err, "error unmarshaling used token")
+	}
+	return &existing, false, nil
+}
+
+func (s *redisTokenStore) List(subject string) ([]idUsed, error) {
+	ctx := context.Background()
+	var out []idUsed
+	var cursor uint64
+	for {
+		keys, next, err := s.client.Scan(ctx, cursor, s.prefix+"*", 100).Result()
+		if err != nil {
+			return nil, errors.Wrap(err, "error scanning redis token store")
+		}
+		for _, k := range keys {
+			raw, err := s.client.Get(ctx, k).Bytes()
+			if err != nil {
+				continue
+			}
+			var u idUsed
+			if err := json.Unmarshal(raw, &u); err != nil {
+				continue
+			}
+			if subject == "" || u.Subject == subject {
+				out = append(out, u)
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (s *redisTokenStore) GC(ctx context.Context) error {
+	return nil // Redis TTLs self-expire entries; nothing to do.
+}
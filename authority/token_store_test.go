@@ -0,0 +1,85 @@
+package authority
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenExpiry(t *testing.T) {
+	usedAt := time.Unix(1000, 0)
+
+	if got := tokenExpiry(usedAt, time.Hour); got != usedAt.Add(time.Hour).Unix() {
+		t.Errorf("tokenExpiry() = %d, want %d", got, usedAt.Add(time.Hour).Unix())
+	}
+	if got := tokenExpiry(usedAt, 0); got != 0 {
+		t.Errorf("tokenExpiry() with zero ttl = %d, want 0 (no expiry)", got)
+	}
+}
+
+func TestIsTokenExpired(t *testing.T) {
+	now := time.Unix(10_000, 0)
+
+	cases := []struct {
+		name string
+		u    idUsed
+		want bool
+	}{
+		{"no expiry set", idUsed{ExpiresAt: 0}, false},
+		{"expiry in the future", idUsed{ExpiresAt: now.Add(time.Minute).Unix()}, false},
+		{"expiry in the past", idUsed{ExpiresAt: now.Add(-time.Minute).Unix()}, true},
+		{"expiry exactly now", idUsed{ExpiresAt: now.Unix()}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isTokenExpired(c.u, now); got != c.want {
+				t.Errorf("isTokenExpired() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMemoryTokenStore_LoadOrStore(t *testing.T) {
+	s := newMemoryTokenStore()
+
+	existing, stored, err := s.LoadOrStore("jti-1", time.Now(), "alice", time.Hour)
+	if err != nil {
+		t.Fatalf("LoadOrStore() error = %v", err)
+	}
+	if !stored || existing != nil {
+		t.Fatalf("LoadOrStore() first call = (%v, %v), want (nil, true)", existing, stored)
+	}
+
+	existing, stored, err = s.LoadOrStore("jti-1", time.Now(), "alice", time.Hour)
+	if err != nil {
+		t.Fatalf("LoadOrStore() error = %v", err)
+	}
+	if stored || existing == nil || existing.Subject != "alice" {
+		t.Fatalf("LoadOrStore() replay = (%+v, %v), want existing entry, false", existing, stored)
+	}
+}
+
+func TestMemoryTokenStore_List(t *testing.T) {
+	s := newMemoryTokenStore()
+	if _, _, err := s.LoadOrStore("jti-1", time.Now(), "alice", time.Hour); err != nil {
+		t.Fatalf("LoadOrStore() error = %v", err)
+	}
+	if _, _, err := s.LoadOrStore("jti-2", time.Now(), "bob", time.Hour); err != nil {
+		t.Fatalf("LoadOrStore() error = %v", err)
+	}
+
+	tokens, err := s.List("alice")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].Subject != "alice" {
+		t.Errorf("List(\"alice\") = %+v, want a single token for alice", tokens)
+	}
+
+	all, err := s.List("")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("List(\"\") returned %d tokens, want 2", len(all))
+	}
+}